@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"io"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	signer "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
@@ -15,14 +20,65 @@ type Client struct {
 	client *s3.Client
 }
 
-func NewClient(cfg aws.Config) *Client {
-	client := s3.NewFromConfig(cfg)
+func NewClient(cfg aws.Config, optFns ...func(*s3.Options)) *Client {
+	client := s3.NewFromConfig(cfg, optFns...)
 	return &Client{client: client}
 }
 
+// WithEndpoint points the client at a custom S3-compatible endpoint, e.g.
+// MinIO, Ceph RGW, Cloudflare R2 or Backblaze B2.
+func WithEndpoint(endpointURL string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if endpointURL != "" {
+			o.BaseEndpoint = aws.String(endpointURL)
+		}
+	}
+}
+
+// WithPathStyle forces path-style addressing (endpoint/bucket/key instead of
+// bucket.endpoint/key), which most non-AWS S3-compatible providers require.
+func WithPathStyle(pathStyle bool) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.UsePathStyle = pathStyle
+	}
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification, for
+// endpoints using self-signed certificates during local development.
+func WithInsecureSkipVerify(insecure bool) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if !insecure {
+			return
+		}
+		o.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+}
+
 type Object struct {
-	Bucket string
-	Key    string
+	Bucket    string
+	Key       string
+	VersionID string
+
+	// SSECustomerKey is the raw (not base64-encoded) customer-provided key
+	// for SSE-C requests, e.g. the contents of the file passed to --sse-c-key.
+	SSECustomerKey []byte
+}
+
+// sseCustomerKeyHeaders derives the SSECustomerAlgorithm/Key/KeyMD5 header
+// values S3 expects for SSE-C from a raw customer-provided key. It returns
+// all-nil when rawKey is empty, so requests that don't use SSE-C are unaffected.
+func sseCustomerKeyHeaders(rawKey []byte) (algorithm, key, keyMD5 *string) {
+	if len(rawKey) == 0 {
+		return nil, nil, nil
+	}
+	sum := md5.Sum(rawKey)
+	return aws.String("AES256"),
+		aws.String(base64.StdEncoding.EncodeToString(rawKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
 }
 
 func (c *Client) ListBuckets(ctx context.Context) (*s3.ListBucketsOutput, error) {
@@ -36,10 +92,22 @@ func (c *Client) ListObjects(ctx context.Context, bucket string, keyPrefix strin
 	})
 }
 
+func (c *Client) ListObjectVersions(ctx context.Context, bucket string, keyPrefix string) (*s3.ListObjectVersionsOutput, error) {
+	return c.client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket: pointerOrNil(bucket),
+		Prefix: pointerOrNil(keyPrefix),
+	})
+}
+
 func (c *Client) GetObject(ctx context.Context, obj *Object) (io.Reader, func(), error) {
+	sseAlgorithm, sseKey, sseKeyMD5 := sseCustomerKeyHeaders(obj.SSECustomerKey)
 	res, err := c.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: pointerOrNil(obj.Bucket),
-		Key:    pointerOrNil(obj.Key),
+		Bucket:               pointerOrNil(obj.Bucket),
+		Key:                  pointerOrNil(obj.Key),
+		VersionId:            pointerOrNil(obj.VersionID),
+		SSECustomerAlgorithm: sseAlgorithm,
+		SSECustomerKey:       sseKey,
+		SSECustomerKeyMD5:    sseKeyMD5,
 	})
 	if err != nil {
 		return nil, nil, err
@@ -52,19 +120,31 @@ func (c *Client) GetObject(ctx context.Context, obj *Object) (io.Reader, func(),
 }
 
 type PutObjectInput struct {
-	Object        *Object
-	Body          io.Reader
-	ContentLength int64
-	ContentType   string
+	Object               *Object
+	Body                 io.Reader
+	ContentLength        int64
+	ContentType          string
+	Metadata             map[string]string
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
+	StorageClass         types.StorageClass
 }
 
 func (c *Client) PutObject(ctx context.Context, input PutObjectInput) error {
+	sseAlgorithm, sseKey, sseKeyMD5 := sseCustomerKeyHeaders(input.Object.SSECustomerKey)
 	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        pointerOrNil(input.Object.Bucket),
-		Key:           pointerOrNil(input.Object.Key),
-		Body:          input.Body,
-		ContentLength: pointerOrNil(input.ContentLength),
-		ContentType:   pointerOrNil(input.ContentType),
+		Bucket:               pointerOrNil(input.Object.Bucket),
+		Key:                  pointerOrNil(input.Object.Key),
+		Body:                 input.Body,
+		ContentLength:        pointerOrNil(input.ContentLength),
+		ContentType:          pointerOrNil(input.ContentType),
+		Metadata:             input.Metadata,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          pointerOrNil(input.SSEKMSKeyID),
+		SSECustomerAlgorithm: sseAlgorithm,
+		SSECustomerKey:       sseKey,
+		SSECustomerKeyMD5:    sseKeyMD5,
+		StorageClass:         input.StorageClass,
 	})
 	return err
 }
@@ -77,7 +157,8 @@ func (c *Client) DeleteObjects(ctx context.Context, objs []*Object) error {
 			return errors.New("cannot delete multiple bucket objects at once")
 		}
 		deleteObjects = append(deleteObjects, types.ObjectIdentifier{
-			Key: aws.String(obj.Key),
+			Key:       aws.String(obj.Key),
+			VersionId: pointerOrNil(obj.VersionID),
 		})
 	}
 	_, err := c.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
@@ -89,11 +170,78 @@ func (c *Client) DeleteObjects(ctx context.Context, objs []*Object) error {
 	return err
 }
 
-func (c *Client) PresignGetObject(ctx context.Context, obj *Object) (*signer.PresignedHTTPRequest, error) {
+// ListAllObjects pages through every key under keyPrefix and returns them all.
+func (c *Client) ListAllObjects(ctx context.Context, bucket, keyPrefix string) ([]types.Object, error) {
+	var all []types.Object
+	var continuationToken *string
+	for {
+		res, err := c.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            pointerOrNil(keyPrefix),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, res.Contents...)
+		if !aws.ToBool(res.IsTruncated) {
+			return all, nil
+		}
+		continuationToken = res.NextContinuationToken
+	}
+}
+
+// DeleteObjectsRecursive pages through every key under keyPrefix and deletes
+// them in batches of up to 1000, the limit of a single DeleteObjects call.
+func (c *Client) DeleteObjectsRecursive(ctx context.Context, bucket, keyPrefix string) error {
+	var continuationToken *string
+	for {
+		res, err := c.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            pointerOrNil(keyPrefix),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return err
+		}
+		objs := make([]*Object, 0, len(res.Contents))
+		for _, o := range res.Contents {
+			objs = append(objs, &Object{Bucket: bucket, Key: *o.Key})
+		}
+		if len(objs) > 0 {
+			if err := c.DeleteObjects(ctx, objs); err != nil {
+				return err
+			}
+		}
+		if !aws.ToBool(res.IsTruncated) {
+			return nil
+		}
+		continuationToken = res.NextContinuationToken
+	}
+}
+
+func (c *Client) PresignGetObject(ctx context.Context, obj *Object, expires time.Duration) (*signer.PresignedHTTPRequest, error) {
 	return s3.NewPresignClient(c.client).PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: pointerOrNil(obj.Bucket),
-		Key:    pointerOrNil(obj.Key),
-	})
+		Bucket:    pointerOrNil(obj.Bucket),
+		Key:       pointerOrNil(obj.Key),
+		VersionId: pointerOrNil(obj.VersionID),
+	}, s3.WithPresignExpires(expires))
+}
+
+type PresignPutObjectInput struct {
+	Object        *Object
+	ContentType   string
+	ContentLength int64
+	Expires       time.Duration
+}
+
+func (c *Client) PresignPutObject(ctx context.Context, input PresignPutObjectInput) (*signer.PresignedHTTPRequest, error) {
+	return s3.NewPresignClient(c.client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        pointerOrNil(input.Object.Bucket),
+		Key:           pointerOrNil(input.Object.Key),
+		ContentType:   pointerOrNil(input.ContentType),
+		ContentLength: pointerOrNil(input.ContentLength),
+	}, s3.WithPresignExpires(input.Expires))
 }
 
 func pointerOrNil[T comparable](v T) *T {
@@ -5,57 +5,106 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 var version = "dev"
 
-const helpMessage = `Usage: s3-client [command] args...
+const helpMessage = `Usage: s3-client [--endpoint-url URL] [--path-style] [--region REGION] [--profile PROFILE] [command] args...
 
 Command:
   help
   version
   whoami
 
-  get         bucket/key localFile
-  cat         bucket/key
-  zcat        bucket/key
+  get         [--sse-c-key FILE] bucket/key localFile
+  cat         [--sse-c-key FILE] bucket/key
+  zcat        [--sse-c-key FILE] bucket/key
 
   ls          bucket
   ls          bucket/keyPrefix
+  ls          [--versions] bucket/keyPrefix
+  ls          [--long] bucket/keyPrefix
+
+  stat        bucket/key[@versionID]
 
   put         [--content-type TYPE] localFile bucket/key
+  put         [--multipart] [--concurrency N] [--part-size SIZE] [--resume] localFile bucket/key
+  put         [--sse {AES256|aws:kms|aws:kms:dsse}] [--sse-kms-key-id KEY] [--sse-c-key FILE]
+              [--storage-class CLASS] [--metadata k=v ...] localFile bucket/key
+
+  rm          bucket/key[@versionID]
+  rm          --recursive bucket/keyPrefix
+
+  sync        [--delete] [--dry-run] [--concurrency N] [--exclude GLOB] [--include GLOB] localDir s3://bucket/keyPrefix
+  sync        [--delete] [--dry-run] [--concurrency N] [--exclude GLOB] [--include GLOB] s3://bucket/keyPrefix localDir
 
-  private-url bucket/key
-  public-url  bucket/key
+  private-url     [--expires DURATION] bucket/key[@versionID]
+  private-put-url [--expires DURATION] [--content-type TYPE] [--content-length N] bucket/key
+  public-url      bucket/key
 `
 
+// globalFlags are parsed ahead of the subcommand and configure the AWS
+// config and S3 client, so the same binary works against AWS and
+// S3-compatible providers such as MinIO, Ceph RGW, R2 or B2.
+type globalFlags struct {
+	EndpointURL string
+	PathStyle   bool
+	Region      string
+	Profile     string
+	Insecure    bool
+}
+
 func main() {
-	if len(os.Args) <= 1 {
+	fs := flag.NewFlagSet("s3-client", flag.ContinueOnError)
+	global := globalFlags{}
+	fs.StringVar(&global.EndpointURL, "endpoint-url", os.Getenv("S3_ENDPOINT_URL"), "")
+	fs.BoolVar(&global.PathStyle, "path-style", os.Getenv("S3_FORCE_PATH_STYLE") == "true", "")
+	fs.StringVar(&global.Region, "region", os.Getenv("AWS_REGION"), "")
+	fs.StringVar(&global.Profile, "profile", "", "")
+	fs.BoolVar(&global.Insecure, "insecure", false, "")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(1)
+	}
+	rest := fs.Args()
+	if len(rest) == 0 {
 		fmt.Fprintln(os.Stderr, "need argument")
 		os.Exit(1)
 	}
 
-	if err := run(context.Background(), os.Args[1], os.Args[2:]...); err != nil {
+	if err := run(context.Background(), global, rest[0], rest[1:]...); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, cmd string, args ...string) error {
-	cfg, err := config.LoadDefaultConfig(ctx)
+func run(ctx context.Context, global globalFlags, cmd string, args ...string) error {
+	var configOptFns []func(*config.LoadOptions) error
+	if global.Region != "" {
+		configOptFns = append(configOptFns, config.WithRegion(global.Region))
+	}
+	if global.Profile != "" {
+		configOptFns = append(configOptFns, config.WithSharedConfigProfile(global.Profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, configOptFns...)
 	if err != nil {
 		return err
 	}
+	newClient := func() *Client {
+		return NewClient(cfg, WithEndpoint(global.EndpointURL), WithPathStyle(global.PathStyle), WithInsecureSkipVerify(global.Insecure))
+	}
 
 	switch cmd {
 	case "help", "-h", "--help":
@@ -72,16 +121,28 @@ func run(ctx context.Context, cmd string, args ...string) error {
 		jsonDump(res)
 		return nil
 	case "cat":
-		if err := needArgs(args, 1); err != nil {
+		fs := flag.NewFlagSet("cat", flag.ContinueOnError)
+		sseCKeyFile := fs.String("sse-c-key", "", "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 1); err != nil {
 			return err
 		}
-		bucket, key, err := parseAsObject(args[0], true)
+		bucket, key, versionID, err := parseAsObject(rest[0], true)
 		if err != nil {
 			return err
 		}
-		reader, closes, err := NewClient(cfg).GetObject(ctx, &Object{
-			Bucket: bucket,
-			Key:    key,
+		sseCustomerKey, err := readSSECKeyFile(*sseCKeyFile)
+		if err != nil {
+			return err
+		}
+		reader, closes, err := newClient().GetObject(ctx, &Object{
+			Bucket:         bucket,
+			Key:            key,
+			VersionID:      versionID,
+			SSECustomerKey: sseCustomerKey,
 		})
 		if err != nil {
 			return err
@@ -90,16 +151,28 @@ func run(ctx context.Context, cmd string, args ...string) error {
 		_, err = io.Copy(os.Stdout, reader)
 		return err
 	case "zcat":
-		if err := needArgs(args, 1); err != nil {
+		fs := flag.NewFlagSet("zcat", flag.ContinueOnError)
+		sseCKeyFile := fs.String("sse-c-key", "", "")
+		if err := fs.Parse(args); err != nil {
 			return err
 		}
-		bucket, key, err := parseAsObject(args[0], true)
+		rest := fs.Args()
+		if err := needArgs(rest, 1); err != nil {
+			return err
+		}
+		bucket, key, versionID, err := parseAsObject(rest[0], true)
+		if err != nil {
+			return err
+		}
+		sseCustomerKey, err := readSSECKeyFile(*sseCKeyFile)
 		if err != nil {
 			return err
 		}
-		reader, closes, err := NewClient(cfg).GetObject(ctx, &Object{
-			Bucket: bucket,
-			Key:    key,
+		reader, closes, err := newClient().GetObject(ctx, &Object{
+			Bucket:         bucket,
+			Key:            key,
+			VersionID:      versionID,
+			SSECustomerKey: sseCustomerKey,
 		})
 		if err != nil {
 			return err
@@ -112,21 +185,31 @@ func run(ctx context.Context, cmd string, args ...string) error {
 		_, err = io.Copy(os.Stdout, gzipReader)
 		return err
 	case "get":
-		if err := needArgs(args, 1, 2); err != nil {
+		fs := flag.NewFlagSet("get", flag.ContinueOnError)
+		sseCKeyFile := fs.String("sse-c-key", "", "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 1, 2); err != nil {
+			return err
+		}
+		bucket, key, versionID, err := parseAsObject(rest[0], true)
+		if err != nil {
 			return err
 		}
-		bucket, key, err := parseAsObject(args[0], true)
+		sseCustomerKey, err := readSSECKeyFile(*sseCKeyFile)
 		if err != nil {
 			return err
 		}
 		var localFile string
-		if len(args) == 1 {
+		if len(rest) == 1 {
 			localFile = strings.ReplaceAll(key, "/", "_")
-		} else if len(args) == 2 {
-			localFile = args[1]
-			if info, err := os.Stat(args[1]); err == nil {
+		} else if len(rest) == 2 {
+			localFile = rest[1]
+			if info, err := os.Stat(rest[1]); err == nil {
 				if info.IsDir() {
-					localFile = filepath.Join(args[1], strings.ReplaceAll(key, "/", "_"))
+					localFile = filepath.Join(rest[1], strings.ReplaceAll(key, "/", "_"))
 				}
 			}
 		}
@@ -136,9 +219,11 @@ func run(ctx context.Context, cmd string, args ...string) error {
 		}
 		defer f.Close()
 		defer os.Remove(localFile + "_tmp")
-		reader, closes, err := NewClient(cfg).GetObject(ctx, &Object{
-			Bucket: bucket,
-			Key:    key,
+		reader, closes, err := newClient().GetObject(ctx, &Object{
+			Bucket:         bucket,
+			Key:            key,
+			VersionID:      versionID,
+			SSECustomerKey: sseCustomerKey,
 		})
 		if err != nil {
 			return err
@@ -150,11 +235,18 @@ func run(ctx context.Context, cmd string, args ...string) error {
 		f.Close()
 		return os.Rename(localFile+"_tmp", localFile)
 	case "ls":
-		if err := needArgs(args, 0, 1); err != nil {
+		fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+		versions := fs.Bool("versions", false, "")
+		long := fs.Bool("long", false, "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 0, 1); err != nil {
 			return err
 		}
-		if len(args) == 0 {
-			res, err := NewClient(cfg).ListBuckets(ctx)
+		if len(rest) == 0 {
+			res, err := newClient().ListBuckets(ctx)
 			if err != nil {
 				return err
 			}
@@ -165,14 +257,34 @@ func run(ctx context.Context, cmd string, args ...string) error {
 			}
 			return nil
 		}
-		bucket, keyPrefix, err := parseAsObject(args[0], false)
+		bucket, keyPrefix, _, err := parseAsObject(rest[0], false)
 		if err != nil {
 			return err
 		}
-		res, err := NewClient(cfg).ListObjects(ctx, bucket, keyPrefix)
+		if *versions {
+			res, err := newClient().ListObjectVersions(ctx, bucket, keyPrefix)
+			if err != nil {
+				return err
+			}
+			for _, v := range res.Versions {
+				tm := v.LastModified.Local().Format(time.RFC3339)
+				fmt.Printf("%s %s %10d %s/%s\n", tm, *v.VersionId, *v.Size, bucket, *v.Key)
+			}
+			for _, d := range res.DeleteMarkers {
+				tm := d.LastModified.Local().Format(time.RFC3339)
+				fmt.Printf("%s %s %10s %s/%s (delete marker)\n", tm, *d.VersionId, "-", bucket, *d.Key)
+			}
+			fmt.Fprintf(os.Stderr, "IsTruncated: %v\n", *res.IsTruncated)
+			return nil
+		}
+		client := newClient()
+		res, err := client.ListObjects(ctx, bucket, keyPrefix)
 		if err != nil {
 			return err
 		}
+		if *long {
+			return lsLong(ctx, client, bucket, res)
+		}
 		for _, obj := range res.Contents {
 			tm := obj.LastModified.Local().Format(time.RFC3339)
 			key := obj.Key
@@ -182,15 +294,35 @@ func run(ctx context.Context, cmd string, args ...string) error {
 		fmt.Fprintf(os.Stderr, "IsTruncated: %v\n", *res.IsTruncated)
 		return nil
 	case "put":
-		contentType := ""
-		if len(args) > 2 && args[0] == "--content-type" {
-			contentType = args[1]
-			args = args[2:]
+		fs := flag.NewFlagSet("put", flag.ContinueOnError)
+		contentType := fs.String("content-type", "", "")
+		multipart := fs.Bool("multipart", false, "")
+		resume := fs.Bool("resume", false, "")
+		concurrency := fs.Int("concurrency", defaultConcurrency, "")
+		partSizeStr := fs.String("part-size", "16MiB", "")
+		sse := fs.String("sse", "", "")
+		sseKMSKeyID := fs.String("sse-kms-key-id", "", "")
+		sseCKeyFile := fs.String("sse-c-key", "", "")
+		storageClass := fs.String("storage-class", "", "")
+		var metadata repeatableFlag
+		fs.Var(&metadata, "metadata", "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 2); err != nil {
+			return err
+		}
+		partSize, err := parseSize(*partSizeStr)
+		if err != nil {
+			return err
 		}
-		if err := needArgs(args, 2); err != nil {
+		metadataMap, err := parseMetadata(metadata)
+		if err != nil {
 			return err
 		}
-		f, err := os.Open(args[0])
+
+		f, err := os.Open(rest[0])
 		if err != nil {
 			return err
 		}
@@ -200,51 +332,185 @@ func run(ctx context.Context, cmd string, args ...string) error {
 			return err
 		}
 
-		bucket, key, err := parseAsObject(args[1], true)
+		bucket, key, _, err := parseAsObject(rest[1], true)
 		if err != nil {
 			return err
 		}
-		return NewClient(cfg).PutObject(ctx, PutObjectInput{
-			Object: &Object{
-				Bucket: bucket,
-				Key:    key,
-			},
-			Body:          f,
-			ContentLength: info.Size(),
-			ContentType:   contentType,
+		obj := &Object{Bucket: bucket, Key: key}
+		obj.SSECustomerKey, err = readSSECKeyFile(*sseCKeyFile)
+		if err != nil {
+			return err
+		}
+		if *multipart || *resume || info.Size() > multipartThreshold {
+			return newClient().PutObjectMultipart(ctx, PutObjectMultipartInput{
+				Object:               obj,
+				LocalFile:            rest[0],
+				PartSize:             partSize,
+				Concurrency:          *concurrency,
+				Resume:               *resume,
+				ContentType:          *contentType,
+				Metadata:             metadataMap,
+				ServerSideEncryption: types.ServerSideEncryption(*sse),
+				SSEKMSKeyID:          *sseKMSKeyID,
+				StorageClass:         types.StorageClass(*storageClass),
+			})
+		}
+		return newClient().PutObject(ctx, PutObjectInput{
+			Object:               obj,
+			Body:                 f,
+			ContentLength:        info.Size(),
+			ContentType:          *contentType,
+			Metadata:             metadataMap,
+			ServerSideEncryption: types.ServerSideEncryption(*sse),
+			SSEKMSKeyID:          *sseKMSKeyID,
+			StorageClass:         types.StorageClass(*storageClass),
 		})
 	case "public-url":
 		if err := needArgs(args, 1); err != nil {
 			return err
 		}
-		bucket, key, err := parseAsObject(args[0], true)
+		bucket, key, _, err := parseAsObject(args[0], true)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("https://%s.s3-%s.amazonaws.com/%s\n", bucket, cfg.Region, key)
+		fmt.Println(publicURL(global, cfg.Region, bucket, key))
 		return nil
 	case "private-url":
-		if err := needArgs(args, 1); err != nil {
+		fs := flag.NewFlagSet("private-url", flag.ContinueOnError)
+		expiresStr := fs.String("expires", "", "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 1); err != nil {
+			return err
+		}
+		expires, err := parseExpires(*expiresStr)
+		if err != nil {
+			return err
+		}
+		bucket, key, versionID, err := parseAsObject(rest[0], true)
+		if err != nil {
+			return err
+		}
+		res, err := newClient().PresignGetObject(ctx, &Object{
+			Bucket:    bucket,
+			Key:       key,
+			VersionID: versionID,
+		}, expires)
+		if err != nil {
+			return err
+		}
+		fmt.Println(res.URL)
+		return nil
+	case "private-put-url":
+		fs := flag.NewFlagSet("private-put-url", flag.ContinueOnError)
+		expiresStr := fs.String("expires", "", "")
+		contentType := fs.String("content-type", "", "")
+		contentLength := fs.Int64("content-length", 0, "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 1); err != nil {
 			return err
 		}
-		bucket, key, err := parseAsObject(args[0], true)
+		expires, err := parseExpires(*expiresStr)
 		if err != nil {
 			return err
 		}
-		res, err := NewClient(cfg).PresignGetObject(ctx, &Object{
-			Bucket: bucket,
-			Key:    key,
+		bucket, key, _, err := parseAsObject(rest[0], true)
+		if err != nil {
+			return err
+		}
+		res, err := newClient().PresignPutObject(ctx, PresignPutObjectInput{
+			Object:        &Object{Bucket: bucket, Key: key},
+			ContentType:   *contentType,
+			ContentLength: *contentLength,
+			Expires:       expires,
 		})
 		if err != nil {
 			return err
 		}
 		fmt.Println(res.URL)
 		return nil
+	case "rm":
+		fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+		recursive := fs.Bool("recursive", false, "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 1); err != nil {
+			return err
+		}
+		client := newClient()
+		if *recursive {
+			bucket, keyPrefix, _, err := parseAsObject(rest[0], false)
+			if err != nil {
+				return err
+			}
+			return client.DeleteObjectsRecursive(ctx, bucket, keyPrefix)
+		}
+		bucket, key, versionID, err := parseAsObject(rest[0], true)
+		if err != nil {
+			return err
+		}
+		return client.DeleteObjects(ctx, []*Object{{Bucket: bucket, Key: key, VersionID: versionID}})
+	case "sync":
+		fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+		del := fs.Bool("delete", false, "")
+		dryRun := fs.Bool("dry-run", false, "")
+		concurrency := fs.Int("concurrency", defaultConcurrency, "")
+		var exclude, include repeatableFlag
+		fs.Var(&exclude, "exclude", "")
+		fs.Var(&include, "include", "")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if err := needArgs(rest, 2); err != nil {
+			return err
+		}
+		return RunSync(ctx, newClient(), syncOptions{
+			Src:         rest[0],
+			Dst:         rest[1],
+			Delete:      *del,
+			DryRun:      *dryRun,
+			Concurrency: *concurrency,
+			Exclude:     exclude,
+			Include:     include,
+		})
+	case "stat":
+		if err := needArgs(args, 1); err != nil {
+			return err
+		}
+		bucket, key, versionID, err := parseAsObject(args[0], true)
+		if err != nil {
+			return err
+		}
+		res, err := newClient().HeadObject(ctx, &Object{Bucket: bucket, Key: key, VersionID: versionID})
+		if err != nil {
+			return err
+		}
+		printHeadObject(res)
+		return nil
 	}
 
 	return errors.New("unknown command: " + cmd)
 }
 
+// repeatableFlag collects every value passed to a flag that may appear more
+// than once on the command line, e.g. "--exclude a --exclude b".
+type repeatableFlag []string
+
+func (f *repeatableFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *repeatableFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
 func jsonDump(v any) {
 	b, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
@@ -260,28 +526,114 @@ func needArgs(args []string, needs ...int) error {
 	return errors.New("invalid arguments")
 }
 
-func parseAsObject(arg string, needKey bool) (string, string, error) {
+// publicURL builds the unsigned public URL for a bucket/key, honoring a
+// custom --endpoint-url/S3_ENDPOINT_URL instead of hardcoding AWS's domain.
+func publicURL(global globalFlags, region, bucket, key string) string {
+	if global.EndpointURL == "" {
+		return fmt.Sprintf("https://%s.s3-%s.amazonaws.com/%s", bucket, region, key)
+	}
+	u, err := url.Parse(global.EndpointURL)
+	if err != nil {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(global.EndpointURL, "/"), bucket, key)
+	}
+	if global.PathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", u.Scheme, u.Host, bucket, key)
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", u.Scheme, bucket, u.Host, key)
+}
+
+const (
+	defaultPresignExpires = 15 * time.Minute
+	maxPresignExpires     = 7 * 24 * time.Hour
+)
+
+// parseExpires parses a --expires duration, defaulting to 15m and rejecting
+// anything past the 7 day maximum S3 presigned URLs support.
+func parseExpires(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultPresignExpires, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d > maxPresignExpires {
+		return 0, fmt.Errorf("--expires %s exceeds the maximum of %s", s, maxPresignExpires)
+	}
+	return d, nil
+}
+
+// parseMetadata turns repeated "key=value" --metadata flags into a map.
+func parseMetadata(kvs []string) (map[string]string, error) {
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	metadata := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --metadata %q, want key=value", kv)
+		}
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+// readSSECKeyFile reads the raw SSE-C customer key from --sse-c-key, or
+// returns nil if the flag wasn't given.
+func readSSECKeyFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+func parseSize(s string) (int64, error) {
+	for suffix, mult := range map[string]int64{
+		"GiB": 1 << 30,
+		"MiB": 1 << 20,
+		"KiB": 1 << 10,
+	} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(s, suffix), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return n * mult, nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseAsObject parses "bucket", "bucket/key", "bucket/key@versionID" and
+// their "s3://" equivalents.
+func parseAsObject(arg string, needKey bool) (bucket, key, versionID string, err error) {
 	if strings.HasPrefix(arg, "s3://") {
 		u, err := url.Parse(arg)
 		if err != nil {
-			return "", "", err
+			return "", "", "", err
 		}
 		bucket := u.Host
-		key := u.Path
-		if key == "/" {
-			key = ""
-		}
+		key, versionID := splitVersionID(strings.TrimPrefix(u.Path, "/"))
 		if key == "" && needKey {
-			return "", "", errors.New("need key")
+			return "", "", "", errors.New("need key")
 		}
-		return bucket, key, nil
+		return bucket, key, versionID, nil
 	}
 	parts := strings.SplitN(arg, "/", 2)
 	if len(parts) == 1 {
 		if needKey {
-			return "", "", errors.New("need key")
+			return "", "", "", errors.New("need key")
 		}
-		return parts[0], "", nil
+		return parts[0], "", "", nil
 	}
-	return parts[0], parts[1], nil
+	key, versionID = splitVersionID(parts[1])
+	return parts[0], key, versionID, nil
+}
+
+// splitVersionID splits "key@versionID" into its two parts. A key without an
+// "@" suffix is returned unchanged with an empty versionID.
+func splitVersionID(keyAndVersion string) (key, versionID string) {
+	key, versionID, _ = strings.Cut(keyAndVersion, "@")
+	return key, versionID
 }
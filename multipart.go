@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	multipartThreshold  int64 = 64 << 20 // 64 MiB
+	defaultPartSize     int64 = 16 << 20 // 16 MiB
+	defaultConcurrency        = 4
+	uploadPartMaxRetry        = 3
+)
+
+// multipartState is the sidecar persisted next to the source file as
+// "<file>.s3upload.json" so an interrupted upload can be resumed.
+type multipartState struct {
+	Bucket   string          `json:"bucket"`
+	Key      string          `json:"key"`
+	UploadID string          `json:"uploadId"`
+	PartSize int64           `json:"partSize"`
+	Parts    []multipartPart `json:"parts"`
+}
+
+type multipartPart struct {
+	PartNumber     int32  `json:"partNumber"`
+	ETag           string `json:"etag"`
+	ChecksumSHA256 string `json:"checksumSha256"`
+}
+
+func sidecarPath(localFile string) string {
+	return localFile + ".s3upload.json"
+}
+
+func loadMultipartState(localFile, bucket, key string) (*multipartState, error) {
+	b, err := os.ReadFile(sidecarPath(localFile))
+	if err != nil {
+		return nil, err
+	}
+	var state multipartState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+	if state.Bucket != bucket || state.Key != key {
+		return nil, fmt.Errorf("sidecar %s does not match %s/%s", sidecarPath(localFile), bucket, key)
+	}
+	return &state, nil
+}
+
+func (s *multipartState) save(localFile string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecarPath(localFile), b, 0o644)
+}
+
+func removeMultipartState(localFile string) {
+	_ = os.Remove(sidecarPath(localFile))
+}
+
+type PutObjectMultipartInput struct {
+	Object               *Object
+	LocalFile            string
+	PartSize             int64
+	Concurrency          int
+	Resume               bool
+	ContentType          string
+	Metadata             map[string]string
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
+	StorageClass         types.StorageClass
+}
+
+// PutObjectMultipart uploads a file using CreateMultipartUpload, UploadPart
+// and CompleteMultipartUpload, reading fixed-size chunks with a pool of
+// Concurrency workers. Progress is persisted after every completed part so
+// that a subsequent call with Resume set only re-uploads the parts missing
+// from ListParts. On any part's fatal failure, the whole upload is aborted.
+func (c *Client) PutObjectMultipart(ctx context.Context, input PutObjectMultipartInput) error {
+	partSize := input.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	concurrency := input.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	f, err := os.Open(input.LocalFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	state, alreadyDone, err := c.resumeOrCreateMultipartUpload(ctx, input, partSize)
+	if err != nil {
+		return err
+	}
+	// A resumed upload must tile the file using the part size recorded in the
+	// sidecar, not whatever --part-size this invocation was given, or the
+	// not-yet-uploaded parts won't line up with the ones already on S3.
+	partSize = state.PartSize
+	numParts := int32((info.Size() + partSize - 1) / partSize)
+	if numParts == 0 {
+		numParts = 1
+	}
+
+	pending := make(chan int32)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range pending {
+				part, err := c.uploadPart(ctx, f, state, input.Object.SSECustomerKey, partNumber, partSize, info.Size())
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					state.Parts = append(state.Parts, part)
+					_ = state.save(input.LocalFile)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for partNumber := int32(1); partNumber <= numParts; partNumber++ {
+		if _, ok := alreadyDone[partNumber]; ok {
+			continue
+		}
+		pending <- partNumber
+	}
+	close(pending)
+	wg.Wait()
+
+	if firstErr != nil {
+		_, _ = c.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(state.Bucket),
+			Key:      aws.String(state.Key),
+			UploadId: aws.String(state.UploadID),
+		})
+		removeMultipartState(input.LocalFile)
+		return firstErr
+	}
+
+	slices.SortFunc(state.Parts, func(a, b multipartPart) int { return int(a.PartNumber) - int(b.PartNumber) })
+	var completed []types.CompletedPart
+	for _, p := range state.Parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber:     aws.Int32(p.PartNumber),
+			ETag:           aws.String(p.ETag),
+			ChecksumSHA256: pointerOrNil(p.ChecksumSHA256),
+		})
+	}
+	_, err = c.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(state.Bucket),
+		Key:             aws.String(state.Key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return err
+	}
+	removeMultipartState(input.LocalFile)
+	return nil
+}
+
+// resumeOrCreateMultipartUpload returns the state to upload against and the
+// set of part numbers that are already uploaded (and so can be skipped).
+func (c *Client) resumeOrCreateMultipartUpload(ctx context.Context, input PutObjectMultipartInput, partSize int64) (*multipartState, map[int32]bool, error) {
+	alreadyDone := map[int32]bool{}
+	if input.Resume {
+		if state, err := loadMultipartState(input.LocalFile, input.Object.Bucket, input.Object.Key); err == nil {
+			listed, err := c.client.ListParts(ctx, &s3.ListPartsInput{
+				Bucket:   aws.String(state.Bucket),
+				Key:      aws.String(state.Key),
+				UploadId: aws.String(state.UploadID),
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("resume: listing existing parts: %w", err)
+			}
+			state.Parts = state.Parts[:0]
+			for _, p := range listed.Parts {
+				state.Parts = append(state.Parts, multipartPart{
+					PartNumber:     *p.PartNumber,
+					ETag:           *p.ETag,
+					ChecksumSHA256: aws.ToString(p.ChecksumSHA256),
+				})
+				alreadyDone[*p.PartNumber] = true
+			}
+			return state, alreadyDone, nil
+		}
+	}
+
+	sseAlgorithm, sseKey, sseKeyMD5 := sseCustomerKeyHeaders(input.Object.SSECustomerKey)
+	created, err := c.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(input.Object.Bucket),
+		Key:                  aws.String(input.Object.Key),
+		ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+		ContentType:          pointerOrNil(input.ContentType),
+		Metadata:             input.Metadata,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          pointerOrNil(input.SSEKMSKeyID),
+		SSECustomerAlgorithm: sseAlgorithm,
+		SSECustomerKey:       sseKey,
+		SSECustomerKeyMD5:    sseKeyMD5,
+		StorageClass:         input.StorageClass,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	state := &multipartState{
+		Bucket:   input.Object.Bucket,
+		Key:      input.Object.Key,
+		UploadID: *created.UploadId,
+		PartSize: partSize,
+	}
+	return state, alreadyDone, state.save(input.LocalFile)
+}
+
+func (c *Client) uploadPart(ctx context.Context, f *os.File, state *multipartState, sseCustomerKey []byte, partNumber int32, partSize, totalSize int64) (multipartPart, error) {
+	offset := int64(partNumber-1) * partSize
+	length := partSize
+	if offset+length > totalSize {
+		length = totalSize - offset
+	}
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return multipartPart{}, err
+	}
+	md5sum := md5.Sum(buf)
+	sha256sum := sha256.Sum256(buf)
+	sseAlgorithm, sseKey, sseKeyMD5 := sseCustomerKeyHeaders(sseCustomerKey)
+
+	var lastErr error
+	for attempt := 0; attempt < uploadPartMaxRetry; attempt++ {
+		res, err := c.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:               aws.String(state.Bucket),
+			Key:                  aws.String(state.Key),
+			UploadId:             aws.String(state.UploadID),
+			PartNumber:           aws.Int32(partNumber),
+			Body:                 bytes.NewReader(buf),
+			ContentMD5:           aws.String(base64.StdEncoding.EncodeToString(md5sum[:])),
+			ChecksumSHA256:       aws.String(base64.StdEncoding.EncodeToString(sha256sum[:])),
+			SSECustomerAlgorithm: sseAlgorithm,
+			SSECustomerKey:       sseKey,
+			SSECustomerKeyMD5:    sseKeyMD5,
+		})
+		if err == nil {
+			return multipartPart{
+				PartNumber:     partNumber,
+				ETag:           *res.ETag,
+				ChecksumSHA256: aws.ToString(res.ChecksumSHA256),
+			}, nil
+		}
+		lastErr = err
+	}
+	return multipartPart{}, fmt.Errorf("part %d: %w", partNumber, lastErr)
+}
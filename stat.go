@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func (c *Client) HeadObject(ctx context.Context, obj *Object) (*s3.HeadObjectOutput, error) {
+	return c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:    pointerOrNil(obj.Bucket),
+		Key:       pointerOrNil(obj.Key),
+		VersionId: pointerOrNil(obj.VersionID),
+	})
+}
+
+// lsLong prints one line per listed object, appending storage class and
+// encryption status columns fetched via a bounded pool of HeadObject calls.
+func lsLong(ctx context.Context, client *Client, bucket string, res *s3.ListObjectsV2Output) error {
+	var mu sync.Mutex
+	heads := make(map[string]*s3.HeadObjectOutput, len(res.Contents))
+	jobs := make(chan string)
+	errs := runWorkers(defaultConcurrency, jobs, func(key string) error {
+		h, err := client.HeadObject(ctx, &Object{Bucket: bucket, Key: key})
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		heads[key] = h
+		mu.Unlock()
+		return nil
+	})
+	for _, obj := range res.Contents {
+		jobs <- *obj.Key
+	}
+	close(jobs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	for _, obj := range res.Contents {
+		tm := obj.LastModified.Local().Format(time.RFC3339)
+		h := heads[*obj.Key]
+		enc := "-"
+		if h.ServerSideEncryption != "" {
+			enc = string(h.ServerSideEncryption)
+		}
+		fmt.Printf("%s %10d %s/%s %s %s\n", tm, *obj.Size, bucket, *obj.Key, h.StorageClass, enc)
+	}
+	fmt.Fprintf(os.Stderr, "IsTruncated: %v\n", *res.IsTruncated)
+	return nil
+}
+
+func printHeadObject(res *s3.HeadObjectOutput) {
+	fmt.Printf("ContentLength: %d\n", *res.ContentLength)
+	fmt.Printf("ContentType: %s\n", *res.ContentType)
+	fmt.Printf("ETag: %s\n", *res.ETag)
+	fmt.Printf("LastModified: %s\n", res.LastModified.Local().Format(time.RFC3339))
+	fmt.Printf("StorageClass: %s\n", res.StorageClass)
+	if res.ServerSideEncryption != "" {
+		fmt.Printf("ServerSideEncryption: %s\n", res.ServerSideEncryption)
+	}
+	if res.SSEKMSKeyId != nil {
+		fmt.Printf("SSEKMSKeyId: %s\n", *res.SSEKMSKeyId)
+	}
+	if res.VersionId != nil {
+		fmt.Printf("VersionId: %s\n", *res.VersionId)
+	}
+	for k, v := range res.Metadata {
+		fmt.Printf("x-amz-meta-%s: %s\n", k, v)
+	}
+}
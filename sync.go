@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type syncOptions struct {
+	Src, Dst    string
+	Delete      bool
+	DryRun      bool
+	Concurrency int
+	Exclude     []string
+	Include     []string
+}
+
+// RunSync mirrors a local directory and an S3 prefix, in whichever direction
+// has the local path on one side and an "s3://" path on the other.
+func RunSync(ctx context.Context, client *Client, opts syncOptions) error {
+	srcIsS3 := strings.HasPrefix(opts.Src, "s3://")
+	dstIsS3 := strings.HasPrefix(opts.Dst, "s3://")
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	switch {
+	case !srcIsS3 && dstIsS3:
+		return syncUp(ctx, client, opts, concurrency)
+	case srcIsS3 && !dstIsS3:
+		return syncDown(ctx, client, opts, concurrency)
+	default:
+		return errors.New("sync needs exactly one local directory and one s3:// prefix")
+	}
+}
+
+func (opts syncOptions) included(relPath string) bool {
+	for _, pattern := range opts.Exclude {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Include {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func syncUp(ctx context.Context, client *Client, opts syncOptions, concurrency int) error {
+	bucket, prefix, _, err := parseAsObject(opts.Dst, false)
+	if err != nil {
+		return err
+	}
+	localFiles, err := walkLocalDir(opts.Src)
+	if err != nil {
+		return err
+	}
+	remote, err := client.ListAllObjects(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	remoteByKey := make(map[string]remoteObject, len(remote))
+	for _, o := range remote {
+		remoteByKey[*o.Key] = remoteObject{Size: *o.Size, ETag: strings.Trim(*o.ETag, `"`), LastModified: *o.LastModified}
+	}
+
+	jobs := make(chan string)
+	errs := runWorkers(concurrency, jobs, func(relPath string) error {
+		key := path.Join(prefix, filepath.ToSlash(relPath))
+		localPath := filepath.Join(opts.Src, relPath)
+		info := localFiles[relPath]
+		if remote, ok := remoteByKey[key]; ok {
+			transfer, err := diffNeedsTransfer(localPath, info, remote, false)
+			if err != nil || !transfer {
+				return err
+			}
+		}
+		if opts.DryRun {
+			fmt.Printf("upload: %s -> %s/%s\n", localPath, bucket, key)
+			return nil
+		}
+		return uploadFile(ctx, client, localPath, info, &Object{Bucket: bucket, Key: key})
+	})
+	for relPath := range localFiles {
+		if !opts.included(relPath) {
+			continue
+		}
+		jobs <- relPath
+	}
+	close(jobs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	if opts.Delete {
+		var toDelete []*Object
+		for key := range remoteByKey {
+			relPath := strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/")
+			if _, ok := localFiles[relPath]; ok || !opts.included(relPath) {
+				continue
+			}
+			if opts.DryRun {
+				fmt.Printf("delete: %s/%s\n", bucket, key)
+				continue
+			}
+			toDelete = append(toDelete, &Object{Bucket: bucket, Key: key})
+		}
+		if len(toDelete) > 0 {
+			return client.DeleteObjects(ctx, toDelete)
+		}
+	}
+	return nil
+}
+
+func syncDown(ctx context.Context, client *Client, opts syncOptions, concurrency int) error {
+	bucket, prefix, _, err := parseAsObject(opts.Src, false)
+	if err != nil {
+		return err
+	}
+	remote, err := client.ListAllObjects(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	localFiles, err := walkLocalDir(opts.Dst)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	jobs := make(chan remoteObject)
+	errs := runWorkers(concurrency, jobs, func(obj remoteObject) error {
+		relPath := strings.TrimPrefix(strings.TrimPrefix(obj.Key, prefix), "/")
+		if !opts.included(relPath) {
+			return nil
+		}
+		localPath := filepath.Join(opts.Dst, filepath.FromSlash(relPath))
+		if info, ok := localFiles[relPath]; ok {
+			transfer, err := diffNeedsTransfer(localPath, info, obj, true)
+			if err != nil || !transfer {
+				return err
+			}
+		}
+		if opts.DryRun {
+			fmt.Printf("download: %s/%s -> %s\n", bucket, obj.Key, localPath)
+			return nil
+		}
+		return downloadFile(ctx, client, localPath, &Object{Bucket: bucket, Key: obj.Key}, obj.LastModified)
+	})
+	for _, o := range remote {
+		jobs <- remoteObject{Key: *o.Key, Size: *o.Size, ETag: strings.Trim(*o.ETag, `"`), LastModified: *o.LastModified}
+	}
+	close(jobs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	if opts.Delete {
+		remoteKeys := make(map[string]bool, len(remote))
+		for _, o := range remote {
+			relPath := strings.TrimPrefix(strings.TrimPrefix(*o.Key, prefix), "/")
+			remoteKeys[relPath] = true
+		}
+		for relPath := range localFiles {
+			if remoteKeys[relPath] || !opts.included(relPath) {
+				continue
+			}
+			localPath := filepath.Join(opts.Dst, filepath.FromSlash(relPath))
+			if opts.DryRun {
+				fmt.Printf("delete: %s\n", localPath)
+				continue
+			}
+			if err := os.Remove(localPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type localFile struct {
+	Size    int64
+	ModTime time.Time
+}
+
+type remoteObject struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+func walkLocalDir(dir string) (map[string]localFile, error) {
+	files := make(map[string]localFile)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[relPath] = localFile{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// diffNeedsTransfer reports whether a local/remote pair that exists on both
+// sides still needs to be transferred: a size mismatch always does, an ETag
+// that isn't a plain MD5 (the object was multipart-uploaded) falls back to
+// comparing modification times, and otherwise the local file's MD5 is
+// compared against the ETag. download indicates the direction of transfer:
+// downloadFile sets the local mtime to the object's LastModified on success
+// (see downloadFile), so for a download the local side is only newer than
+// remote once it's been re-uploaded out of band; for an upload it's the
+// local side that's authoritative, so the comparison is flipped.
+func diffNeedsTransfer(localPath string, local localFile, remote remoteObject, download bool) (bool, error) {
+	if local.Size != remote.Size {
+		return true, nil
+	}
+	if strings.Contains(remote.ETag, "-") {
+		if download {
+			return remote.LastModified.After(local.ModTime), nil
+		}
+		return local.ModTime.After(remote.LastModified), nil
+	}
+	sum, err := md5Hex(localPath)
+	if err != nil {
+		return false, err
+	}
+	return sum != remote.ETag, nil
+}
+
+func md5Hex(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func uploadFile(ctx context.Context, client *Client, localPath string, info localFile, obj *Object) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info.Size > multipartThreshold {
+		return client.PutObjectMultipart(ctx, PutObjectMultipartInput{
+			Object:    obj,
+			LocalFile: localPath,
+		})
+	}
+	return client.PutObject(ctx, PutObjectInput{
+		Object:        obj,
+		Body:          f,
+		ContentLength: info.Size,
+	})
+}
+
+// downloadFile streams obj to a temp file next to localPath and atomically
+// renames it into place, the same pattern the "get" command uses. The local
+// mtime is set to lastModified so a later diffNeedsTransfer comparison sees
+// the file as up to date until the remote object actually changes.
+func downloadFile(ctx context.Context, client *Client, localPath string, obj *Object, lastModified time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(localPath + "_tmp")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	defer os.Remove(localPath + "_tmp")
+	reader, closes, err := client.GetObject(ctx, obj)
+	if err != nil {
+		return err
+	}
+	defer closes()
+	if _, err := io.Copy(f, reader); err != nil {
+		return err
+	}
+	f.Close()
+	if err := os.Chtimes(localPath+"_tmp", lastModified, lastModified); err != nil {
+		return err
+	}
+	return os.Rename(localPath+"_tmp", localPath)
+}
+
+// runWorkers starts a pool of goroutines draining jobs through fn, returning
+// a channel that receives the first error encountered (or nil) once every
+// job has been processed and the jobs channel is closed.
+func runWorkers[T any](concurrency int, jobs <-chan T, fn func(T) error) <-chan error {
+	result := make(chan error, 1)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := fn(job); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		result <- firstErr
+	}()
+	return result
+}